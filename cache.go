@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheIndexFile はcacheIndexの永続化先となるファイル名。
+const cacheIndexFile = "index.json"
+
+// cacheIndexEntry はキャッシュ済みObject1件分のメタ情報。Versionは
+// objectWrapper.CacheVersion（ETag、byteRange指定時はそれも含む）に対応する。
+type cacheIndexEntry struct {
+	Bucket     string    `json:"bucket"`
+	Key        string    `json:"key"`
+	Version    string    `json:"version"`
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+func (e *cacheIndexEntry) path(dir string) string {
+	return path.Join(dir, e.Bucket, e.Key, e.Version)
+}
+
+func cacheEntryKey(bucket, key, version string) string {
+	return bucket + "/" + key + "/" + version
+}
+
+// cacheIndex はキャッシュディレクトリ配下のエントリ一覧を管理する。ETagを
+// キーの一部に含めることで、Objectが更新されれば別ファイルとして扱われ、
+// 古い内容を誤って返すことがないようにする。
+type cacheIndex struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]*cacheIndexEntry // key: cacheEntryKey(bucket, key, etag)
+}
+
+// loadCacheIndex はdir配下のindex.jsonを読み込む。存在しない場合は空のindexを返す。
+func loadCacheIndex(dir string) (*cacheIndex, error) {
+	idx := &cacheIndex{dir: dir, entries: map[string]*cacheIndexEntry{}}
+
+	b, err := os.ReadFile(path.Join(dir, cacheIndexFile))
+	if os.IsNotExist(err) {
+		return idx, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read cache index : %w", err)
+	}
+
+	var entries []*cacheIndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse cache index : %w", err)
+	}
+	for _, e := range entries {
+		idx.entries[cacheEntryKey(e.Bucket, e.Key, e.Version)] = e
+	}
+	return idx, nil
+}
+
+// saveLocked はindexをdir配下のindex.jsonへ書き出す。呼び出し側でidx.muを
+// 保持していることを前提とする。
+func (idx *cacheIndex) saveLocked() error {
+	entries := make([]*cacheIndexEntry, 0, len(idx.entries))
+	for _, e := range idx.entries {
+		entries = append(entries, e)
+	}
+
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache index : %w", err)
+	}
+
+	if err := os.MkdirAll(idx.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory : %w", err)
+	}
+	if err := os.WriteFile(path.Join(idx.dir, cacheIndexFile), b, 0644); err != nil {
+		return fmt.Errorf("failed to write cache index : %w", err)
+	}
+	return nil
+}
+
+// Lookup はbucket/key/versionに一致するキャッシュ済みファイルのパスを返す。
+// indexにエントリがあってもファイル本体がない、あるいはファイルサイズが
+// Put時に記録したサイズと一致しない場合はキャッシュミスとして扱う
+// （byteRange指定時はPutされるのが実際にダウンロードした範囲分のサイズのため、
+// ここでもObject全体のサイズではなくそれと比較する）。
+func (idx *cacheIndex) Lookup(bucket, key, version string) (string, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	k := cacheEntryKey(bucket, key, version)
+	e, ok := idx.entries[k]
+	if !ok {
+		return "", false
+	}
+
+	fp := e.path(idx.dir)
+	if fi, err := os.Stat(fp); err != nil || fi.Size() != e.Size {
+		delete(idx.entries, k)
+		return "", false
+	}
+
+	e.LastAccess = time.Now()
+	return fp, true
+}
+
+// Save はindexをindex.jsonへ書き出す。Lookupでの最終アクセス更新のように、
+// saveLockedを即座には呼ばない操作の後に、まとめて永続化するために使う。
+func (idx *cacheIndex) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.saveLocked()
+}
+
+// Put はダウンロード済みのファイルをindexへ登録する。sizeは呼び出し側が実際に
+// 書き込んだバイト数を渡すこと（byteRange指定時はObject全体のサイズではなく、
+// ダウンロードした範囲分のサイズになる）。
+func (idx *cacheIndex) Put(bucket, key, version string, size int64) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.entries[cacheEntryKey(bucket, key, version)] = &cacheIndexEntry{
+		Bucket:     bucket,
+		Key:        key,
+		Version:    version,
+		Size:       size,
+		LastAccess: time.Now(),
+	}
+	return idx.saveLocked()
+}
+
+// Prune はキャッシュの合計サイズがmaxSizeを超えている場合に、最終アクセスが
+// 古いエントリから削除し、maxSize以下になるようにする。maxSizeが0の場合は
+// 無制限として何もしない。
+func (idx *cacheIndex) Prune(maxSize uint64) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if maxSize == 0 {
+		return nil
+	}
+
+	entries := make([]*cacheIndexEntry, 0, len(idx.entries))
+	var total uint64
+	for _, e := range idx.entries {
+		entries = append(entries, e)
+		total += uint64(e.Size)
+	}
+	if total <= maxSize {
+		return nil
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastAccess.Before(entries[j].LastAccess)
+	})
+
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(e.path(idx.dir)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to evict cache entry '%s' : %w", e.path(idx.dir), err)
+		}
+		delete(idx.entries, cacheEntryKey(e.Bucket, e.Key, e.Version))
+		total -= uint64(e.Size)
+	}
+
+	return idx.saveLocked()
+}
+
+// clearCache はdir配下のキャッシュファイルとindexをすべて削除する。
+func clearCache(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clear cache directory '%s' : %w", dir, err)
+	}
+	return nil
+}
+
+// cleanETag はS3が返すETagの前後の二重引用符を取り除く。
+func cleanETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// newTestCacheIndex はdir配下に1件分のキャッシュファイルを書き込み、対応する
+// エントリをidxへ登録する。
+func newTestCacheIndex(t *testing.T, dir string) *cacheIndex {
+	t.Helper()
+	return &cacheIndex{dir: dir, entries: map[string]*cacheIndexEntry{}}
+}
+
+func putTestFile(t *testing.T, idx *cacheIndex, bucket, key, version string, content []byte, lastAccess time.Time) {
+	t.Helper()
+	fp := path.Join(idx.dir, bucket, key, version)
+	if err := os.MkdirAll(path.Dir(fp), 0755); err != nil {
+		t.Fatalf("failed to create dir : %v", err)
+	}
+	if err := os.WriteFile(fp, content, 0644); err != nil {
+		t.Fatalf("failed to write file : %v", err)
+	}
+	idx.entries[cacheEntryKey(bucket, key, version)] = &cacheIndexEntry{
+		Bucket:     bucket,
+		Key:        key,
+		Version:    version,
+		Size:       int64(len(content)),
+		LastAccess: lastAccess,
+	}
+}
+
+func TestCacheIndexLookup(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestCacheIndex(t, dir)
+	putTestFile(t, idx, "b", "k", "v1", []byte("hello"), time.Now())
+
+	if _, ok := idx.Lookup("b", "k", "v1"); !ok {
+		t.Fatal("expected cache hit for matching bucket/key/version")
+	}
+	if _, ok := idx.Lookup("b", "k", "v2"); ok {
+		t.Fatal("expected cache miss for a different version (e.g. ETag changed)")
+	}
+}
+
+func TestCacheIndexLookupEvictsOnSizeMismatch(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestCacheIndex(t, dir)
+	putTestFile(t, idx, "b", "k", "v1", []byte("hello"), time.Now())
+
+	// ファイルが外部要因で切り詰められた（あるいはPutが実際のサイズとは異なる
+	// サイズを記録した）場合を再現する。
+	fp := path.Join(dir, "b", "k", "v1")
+	if err := os.WriteFile(fp, []byte("he"), 0644); err != nil {
+		t.Fatalf("failed to truncate file : %v", err)
+	}
+
+	if _, ok := idx.Lookup("b", "k", "v1"); ok {
+		t.Fatal("expected cache miss when on-disk size no longer matches the recorded size")
+	}
+	if _, ok := idx.entries[cacheEntryKey("b", "k", "v1")]; ok {
+		t.Fatal("expected stale entry to be evicted from the index")
+	}
+}
+
+func TestCacheIndexLookupEvictsOnMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestCacheIndex(t, dir)
+	putTestFile(t, idx, "b", "k", "v1", []byte("hello"), time.Now())
+
+	if err := os.Remove(path.Join(dir, "b", "k", "v1")); err != nil {
+		t.Fatalf("failed to remove file : %v", err)
+	}
+
+	if _, ok := idx.Lookup("b", "k", "v1"); ok {
+		t.Fatal("expected cache miss when the file no longer exists")
+	}
+}
+
+func TestCacheIndexPrune(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestCacheIndex(t, dir)
+
+	now := time.Now()
+	putTestFile(t, idx, "b", "old", "v1", []byte("0123456789"), now.Add(-2*time.Hour))
+	putTestFile(t, idx, "b", "mid", "v1", []byte("0123456789"), now.Add(-1*time.Hour))
+	putTestFile(t, idx, "b", "new", "v1", []byte("0123456789"), now)
+
+	// 合計30バイトを25バイト以下まで削るので、最終アクセスが古い"old"だけが
+	// 削除され、"mid"・"new"は残るはず。
+	if err := idx.Prune(25); err != nil {
+		t.Fatalf("Prune returned error : %v", err)
+	}
+
+	if _, ok := idx.entries[cacheEntryKey("b", "old", "v1")]; ok {
+		t.Error("expected the least-recently-accessed entry to be evicted")
+	}
+	if _, ok := idx.entries[cacheEntryKey("b", "mid", "v1")]; !ok {
+		t.Error("expected 'mid' entry to survive Prune")
+	}
+	if _, ok := idx.entries[cacheEntryKey("b", "new", "v1")]; !ok {
+		t.Error("expected 'new' entry to survive Prune")
+	}
+	if _, err := os.Stat(path.Join(dir, "b", "old", "v1")); !os.IsNotExist(err) {
+		t.Error("expected evicted entry's file to be removed from disk")
+	}
+}
+
+func TestCacheIndexPruneNoopUnderLimit(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestCacheIndex(t, dir)
+	putTestFile(t, idx, "b", "k", "v1", []byte("0123456789"), time.Now())
+
+	if err := idx.Prune(100); err != nil {
+		t.Fatalf("Prune returned error : %v", err)
+	}
+	if _, ok := idx.entries[cacheEntryKey("b", "k", "v1")]; !ok {
+		t.Error("expected entry to survive Prune when total size is under maxSize")
+	}
+}
+
+func TestCacheIndexPruneUnlimitedWhenZero(t *testing.T) {
+	dir := t.TempDir()
+	idx := newTestCacheIndex(t, dir)
+	putTestFile(t, idx, "b", "k", "v1", []byte("0123456789"), time.Now())
+
+	if err := idx.Prune(0); err != nil {
+		t.Fatalf("Prune returned error : %v", err)
+	}
+	if _, ok := idx.entries[cacheEntryKey("b", "k", "v1")]; !ok {
+		t.Error("expected maxSize=0 to mean unlimited (no eviction)")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/dustin/go-humanize"
+	"github.com/jessevdk/go-flags"
+)
+
+// cacheCommandOptions は`s3cat cache prune|clear`で使用するオプション。
+type cacheCommandOptions struct {
+	CacheDir  string `long:"cache-dir"  description:"対象のキャッシュディレクトリを指定します"`
+	CacheSize string `long:"cache-size" description:"prune後に残すキャッシュの最大サイズを指定します (例: 10GB)"`
+}
+
+// runCacheCommand は`s3cat cache prune|clear`を処理する。argsは"cache"の
+// 次の要素（サブコマンド名とそのオプション）。
+func runCacheCommand(args []string) {
+	if len(args) == 0 {
+		logFatal(errors.New("cache subcommand requires 'prune' or 'clear'"))
+	}
+	sub := args[0]
+
+	copts := cacheCommandOptions{
+		CacheDir: path.Join(os.TempDir(), "s3cat"),
+	}
+	parser := flags.NewParser(&copts, flags.HelpFlag|flags.PassDoubleDash)
+	parser.Name = fmt.Sprintf("%s cache %s", os.Args[0], sub)
+	rest, err := parser.ParseArgs(args[1:])
+	if err != nil {
+		logFatal(err)
+	}
+	if len(rest) != 0 {
+		logFatal(fmt.Errorf("unexpected argument '%s'", rest[0]))
+	}
+
+	switch sub {
+	case "prune":
+		var maxSize uint64
+		if copts.CacheSize != "" {
+			maxSize, err = humanize.ParseBytes(copts.CacheSize)
+			if err != nil {
+				logFatal(fmt.Errorf("failed to parse --cache-size : %w", err))
+			}
+		}
+
+		idx, err := loadCacheIndex(copts.CacheDir)
+		if err != nil {
+			logFatal(err)
+		}
+		if err := idx.Prune(maxSize); err != nil {
+			logFatal(err)
+		}
+	case "clear":
+		if err := clearCache(copts.CacheDir); err != nil {
+			logFatal(err)
+		}
+	default:
+		logFatal(fmt.Errorf("unknown cache subcommand '%s'", sub))
+	}
+}
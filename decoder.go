@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// decoderFactory はr上に展開用のio.Readerを被せる。
+type decoderFactory func(r io.Reader) (io.Reader, error)
+
+// decoders は--decompressで指定可能な展開方式と、それを処理するdecoderFactoryの対応表。
+var decoders = map[string]decoderFactory{
+	"none": func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	},
+	"gzip": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	"bzip2": func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	},
+	"zstd": func(r io.Reader) (io.Reader, error) {
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	},
+	"xz": func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r)
+	},
+}
+
+// suffixFormats はKeyの拡張子から展開方式を特定するための対応表。
+var suffixFormats = []struct {
+	suffix string
+	format string
+}{
+	{".gz", "gzip"},
+	{".bz2", "bzip2"},
+	{".zst", "zstd"},
+	{".xz", "xz"},
+}
+
+// contentEncodingFormats はS3のContent-Encodingヘッダーから展開方式を特定するための対応表。
+var contentEncodingFormats = map[string]string{
+	"gzip":  "gzip",
+	"bzip2": "bzip2",
+	"zstd":  "zstd",
+	"xz":    "xz",
+}
+
+// magicFormats はデータ先頭のマジックバイトから展開方式を特定するための対応表。
+var magicFormats = []struct {
+	magic  []byte
+	format string
+}{
+	{[]byte{0x1f, 0x8b}, "gzip"},
+	{[]byte("BZh"), "bzip2"},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, "zstd"},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "xz"},
+}
+
+// peekLen はマジックバイト判定のために先読みするバイト数。
+const peekLen = 6
+
+// decompressingReader はopts.Decompressの指定に従ってreaderを展開する。
+// "auto"（または未指定）の場合、Keyの拡張子・データ先頭のマジックバイト・S3の
+// Content-Encodingの順に展開方式を推定し、どれにも一致しなければ無展開として扱う。
+// HeadObjectはKeyの拡張子・マジックバイトのどちらからも展開方式が判断できなかった
+// 場合に限って呼び出すため、無圧縮の`.log`・`.txt`等を含む大半のケースでは
+// 余計なAPI呼び出しは発生しない。
+func decompressingReader(ctx context.Context, s3c *s3.S3, object *objectWrapper, reader io.Reader) (io.Reader, error) {
+	format := opts.Decompress
+	if format == "" {
+		format = "auto"
+	}
+
+	if format != "auto" {
+		return newDecoder(format, reader)
+	}
+
+	if f, ok := formatFromSuffix(*object.raw.Key); ok {
+		return newDecoder(f, reader)
+	}
+
+	br := bufio.NewReaderSize(reader, peekLen)
+	peek, _ := br.Peek(peekLen)
+	if f, ok := formatFromMagic(peek); ok {
+		return newDecoder(f, br)
+	}
+
+	ce, err := headContentEncoding(ctx, s3c, object)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := contentEncodingFormats[ce]; ok {
+		return newDecoder(f, br)
+	}
+	return br, nil
+}
+
+func formatFromSuffix(key string) (string, bool) {
+	for _, sf := range suffixFormats {
+		if strings.HasSuffix(key, sf.suffix) {
+			return sf.format, true
+		}
+	}
+	return "", false
+}
+
+func formatFromMagic(peek []byte) (string, bool) {
+	for _, mf := range magicFormats {
+		if len(peek) >= len(mf.magic) && bytes.Equal(peek[:len(mf.magic)], mf.magic) {
+			return mf.format, true
+		}
+	}
+	return "", false
+}
+
+// newDecoder はformatに対応するdecoderFactoryでreaderを包む。
+func newDecoder(format string, reader io.Reader) (io.Reader, error) {
+	factory, ok := decoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported decompress format '%s'", format)
+	}
+	return factory(reader)
+}
+
+// headContentEncoding はHeadObjectを呼び出し、ObjectのContent-Encodingを取得する。
+// 一度取得した結果はobjectにキャッシュし、同じObjectに対して複数回呼び出されないようにする。
+func headContentEncoding(ctx context.Context, s3c *s3.S3, object *objectWrapper) (string, error) {
+	if object.contentEncodingFetched {
+		return object.contentEncoding, nil
+	}
+
+	out, err := s3c.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &object.bucket,
+		Key:    object.raw.Key,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to head object '/%s/%s' : %w", object.bucket, *object.raw.Key, err)
+	}
+
+	object.contentEncodingFetched = true
+	if out.ContentEncoding != nil {
+		object.contentEncoding = *out.ContentEncoding
+	}
+	return object.contentEncoding, nil
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
@@ -21,16 +20,47 @@ import (
 )
 
 type Options struct {
-	Region      string        `short:"r" long:"region"      description:"AWSリージョンを指定します"`
-	Temp        string        `short:"t" long:"temp"        description:"S3Objectのダウンロード先を指定します"`
-	Concurrency int           `short:"c" long:"concurrency" description:"S3Objectの並列ダウンロード数を指定します"`
-	Timeout     time.Duration `short:"e" long:"timeout"     description:"ファイル取得のタイムアウトを設定します"`
-	Verbose     bool          `short:"v" long:"verbose"     description:"詳細な出力を標準エラーに出力します"`
+	Region           string        `short:"r" long:"region"                description:"AWSリージョンを指定します"`
+	Temp             string        `short:"t" long:"temp"                  description:"S3Objectのダウンロード先を指定します"`
+	Concurrency      int           `short:"c" long:"concurrency"           description:"S3Objectの並列ダウンロード数を指定します"`
+	Timeout          time.Duration `short:"e" long:"timeout"               description:"ファイル取得のタイムアウトを設定します"`
+	Verbose          bool          `short:"v" long:"verbose"               description:"詳細な出力を標準エラーに出力します"`
+	Profile          string        `short:"p" long:"profile"               description:"使用する共有認証情報のプロファイル名を指定します"`
+	Endpoint         string        `long:"endpoint"                        description:"MinIO・Ceph・LocalStack等、S3互換エンドポイントのURLを指定します"`
+	S3ForcePathStyle bool          `long:"s3-force-path-style"             description:"パススタイルでのアクセスを強制します (S3互換エンドポイントで必要な場合があります)"`
+	DisableSSL       bool          `long:"disable-ssl"                     description:"エンドポイントへの接続でSSLを無効にします"`
+	NoCache          bool          `long:"no-cache"                        description:"ローカルにキャッシュせず、ダウンロードしたデータを直接ストリーミング出力します"`
+	Decompress       string        `long:"decompress"                      description:"出力前に行う展開方式を指定します (auto|none|gzip|bzip2|zstd|xz)"`
+	CacheDir         string        `long:"cache-dir"                       description:"キャッシュの保存先ディレクトリを指定します (未指定時は--tempを使用)"`
+	CacheSize        string        `long:"cache-size"                      description:"キャッシュの最大サイズを指定します。超過分は最終アクセスが古い順に削除します (例: 10GB、未指定時は無制限)"`
+	PartSize         string        `long:"part-size"                       description:"単一Objectを並列レンジGETでダウンロードする際のパートサイズを指定します (例: 8MB、--concurrencyと併用)"`
+	StartAfter       string        `long:"start-after"                     description:"指定したKeyより後から一覧取得を再開します (ListObjectsV2へそのまま渡されます)"`
+	MaxKeys          int64         `long:"max-keys"                        description:"一覧取得1ページあたりの最大Object数を指定します"`
+	ModifiedSince    string        `long:"modified-since"                  description:"指定日時(RFC3339)以降に更新されたObjectのみを対象にします"`
+	ModifiedBefore   string        `long:"modified-before"                 description:"指定日時(RFC3339)より前に更新されたObjectのみを対象にします"`
 }
 
 var opts = Options{
 	Concurrency: 1,
 	Temp:        path.Join(os.TempDir(), "s3cat"),
+	Decompress:  "auto",
+}
+
+// modifiedSince・modifiedBeforeは--modified-since・--modified-beforeを
+// パースした結果。S3はLastModifiedでのサーバー側絞り込みに対応していないため、
+// listS3Object内でクライアント側フィルタとして使用する。未指定の場合はnil。
+var (
+	modifiedSince  *time.Time
+	modifiedBefore *time.Time
+)
+
+// cacheDir はキャッシュの保存先ディレクトリを返す。--cache-dirが未指定の場合は
+// --tempをそのまま使う。
+func cacheDir() string {
+	if opts.CacheDir != "" {
+		return opts.CacheDir
+	}
+	return opts.Temp
 }
 
 func logFatal(err error) {
@@ -51,6 +81,11 @@ func stderr(format string, a ...interface{}) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCacheCommand(os.Args[2:])
+		return
+	}
+
 	// Parse option
 	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
 	parser.Name = os.Args[0]
@@ -70,11 +105,40 @@ func main() {
 	}
 
 	// Parse pattern
-	inputs, err := parseArgs(args)
+	patterns, err := parseArgs(args)
 	if err != nil {
 		logFatal(err)
 	}
 
+	var maxCacheSize uint64
+	if opts.CacheSize != "" {
+		if maxCacheSize, err = humanize.ParseBytes(opts.CacheSize); err != nil {
+			logFatal(fmt.Errorf("failed to parse --cache-size : %w", err))
+		}
+	}
+
+	var partSize uint64
+	if opts.PartSize != "" {
+		if partSize, err = humanize.ParseBytes(opts.PartSize); err != nil {
+			logFatal(fmt.Errorf("failed to parse --part-size : %w", err))
+		}
+	}
+
+	if opts.ModifiedSince != "" {
+		t, err := time.Parse(time.RFC3339, opts.ModifiedSince)
+		if err != nil {
+			logFatal(fmt.Errorf("failed to parse --modified-since : %w", err))
+		}
+		modifiedSince = &t
+	}
+	if opts.ModifiedBefore != "" {
+		t, err := time.Parse(time.RFC3339, opts.ModifiedBefore)
+		if err != nil {
+			logFatal(fmt.Errorf("failed to parse --modified-before : %w", err))
+		}
+		modifiedBefore = &t
+	}
+
 	// Context
 	var (
 		ctx    = context.Background()
@@ -87,28 +151,55 @@ func main() {
 	}
 
 	// Prepare aws session
-	cfgs := make([]*aws.Config, 0)
+	cfg := aws.Config{}
 	if opts.Region != "" {
-		cfgs = append(cfgs, &aws.Config{
-			Region: &opts.Region,
-		})
+		cfg.Region = &opts.Region
+	}
+	if opts.Endpoint != "" {
+		cfg.Endpoint = &opts.Endpoint
+	}
+	if opts.S3ForcePathStyle {
+		cfg.S3ForcePathStyle = aws.Bool(true)
 	}
-	sess, err := session.NewSession(cfgs...)
+	if opts.DisableSSL {
+		cfg.DisableSSL = aws.Bool(true)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:  cfg,
+		Profile: opts.Profile,
+	})
 	if err != nil {
 		logFatal(err)
 	}
+	s3c := s3.New(sess)
 
 	// Patternに一致するObject一覧を取得
-	objects, err := listS3Objects(ctx, sess, inputs)
+	objects, err := listS3Objects(ctx, s3c, patterns)
 	if err != nil {
 		logFatal(err)
 	}
 
-	// ローカルとの差分をチェック
-	for _, object := range objects {
-		// ローカルに同じサイズのファイルが有る場合のみローカルフラグを立てる
-		fi, err := os.Stat(object.LocalPath(opts.Temp))
-		object.local = err == nil && fi.Size() == *object.raw.Size
+	// キャッシュとの差分をチェック（--no-cache時は常にダウンロードする）
+	var cacheIdx *cacheIndex
+	if !opts.NoCache {
+		if cacheIdx, err = loadCacheIndex(cacheDir()); err != nil {
+			logFatal(err)
+		}
+		var hit bool
+		for _, object := range objects {
+			// bucket+Key+ETagが一致するキャッシュがある場合のみローカルフラグを立てる。
+			// ETagを含めて照合するため、Objectが更新されていれば確実にミスする。
+			_, object.local = cacheIdx.Lookup(object.bucket, *object.raw.Key, object.CacheVersion())
+			hit = hit || object.local
+		}
+		// Lookupが更新するLastAccessはPut/Pruneのように都度saveLockedされないため、
+		// ここでまとめて永続化しないとキャッシュが温まっている再実行でLRU用の
+		// 最終アクセス時刻が古いまま残ってしまう。
+		if hit {
+			if err := cacheIdx.Save(); err != nil {
+				logError(err)
+			}
+		}
 	}
 
 	// ダウンロード一覧を表示する
@@ -130,123 +221,160 @@ func main() {
 		}
 	}
 
-	if opts.Verbose {
+	if opts.Verbose && !opts.NoCache {
 		stderr("Download to '%s'\n", opts.Temp)
 	}
 
 	// ダウンロードサイズを表示
 	stderr("Size : %s\n", humanize.Bytes(download))
 
+	// Object毎のダウンロード完了（--no-cache時は出力開始可能になったタイミング）を
+	// 順序通りに後段の出力処理へ伝えるためのスロット
+	slots := make([]*slot, len(objects))
+	for i, object := range objects {
+		slots[i] = &slot{object: object, ready: make(chan error, 1)}
+	}
+
 	// ダウンロード
 	var (
 		deg, childCtx = errgroup.WithContext(ctx)
-		dsem          = make(chan struct{}, opts.Concurrency)
-		s3m           = s3manager.NewDownloader(sess)
+		s3m           = s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
+			// s3mはworker（後述）により既に--concurrency並列のObjectを同時に
+			// ダウンロードしているため、ここでもd.Concurrencyを--concurrencyにすると、
+			// パート単位のレンジGETも同じだけ重なり合計でconcurrency^2並列まで
+			// 膨れ上がる。レンジ並列ダウンロードは単一Object（複数Objectを
+			// workerで並列化する余地がない場合）に限ってのみ有効化する。
+			if len(objects) == 1 {
+				if opts.Concurrency > 0 {
+					d.Concurrency = opts.Concurrency
+				}
+			} else {
+				d.Concurrency = 1
+			}
+			if partSize > 0 {
+				d.PartSize = int64(partSize)
+			}
+		})
+		s3mSeq = s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
+			// io.Pipeへの書き込みはオフセット順である必要があるため、1並列に固定する
+			d.Concurrency = 1
+		})
 	)
-	for _, object := range objects {
-		if object.local {
-			continue
+
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	// tasksはダウンロードが必要なslotのインデックスを並び順のまま流すキュー。
+	// Object1件ごとにgoroutineを起動すると一覧が数百万件規模のバケットでは
+	// goroutineが際限なく積み上がるため、workers個のworkerだけを起動し、
+	// tasksへの送出（feeder）を並行させることでspawn自体もworkerの空き待ちで
+	// ブロックさせる。feederをメインの処理と並行させるのは、--no-cache時に
+	// 出力ループが動き出せずtasksの送出がブロックされたままになる
+	// （デッドロックする）ことも避けるため。
+	tasks := make(chan int)
+	go func() {
+		defer close(tasks)
+		for i, s := range slots {
+			if s.object.local {
+				s.ready <- nil
+				continue
+			}
+			select {
+			case tasks <- i:
+			case <-childCtx.Done():
+				return
+			}
 		}
+	}()
 
-		dsem <- struct{}{}
-		deg.Go(func(ctx context.Context, object *objectWrapper) func() error {
+	for w := 0; w < workers; w++ {
+		deg.Go(func(ctx context.Context) func() error {
 			return func() error {
-				fp := object.LocalPath(opts.Temp)
-
-				if opts.Verbose {
-					stderr("%s ... Downloading\n", fp)
-				}
+				for i := range tasks {
+					s := slots[i]
 
-				defer func() {
+					fp := s.object.CachePath(cacheDir())
 					if opts.Verbose {
-						stderr("%s ... Done\n", fp)
+						stderr("%s ... Downloading\n", fp)
 					}
-					<-dsem
-				}()
-
-				// ディレクトリがなければ作る
-				dir := path.Dir(fp)
-				if fi, err := os.Stat(dir); os.IsNotExist(err) {
-					if err := os.MkdirAll(dir, 0755); err != nil {
-						logFatal(fmt.Errorf("failed to create directory : %w", err))
+
+					var err error
+					if opts.NoCache {
+						// readerの準備ができ次第slot.readyを通知するため、完了通知は
+						// downloadStreaming内（Reader確保の直後）で行う
+						err = downloadStreaming(ctx, s3mSeq, s)
+					} else {
+						err = downloadToFile(ctx, s3m, fp, s.object)
+						if err == nil {
+							// byteRange指定時はraw.Size（Object全体のサイズ）ではなく、
+							// 実際にダウンロードした範囲のサイズをキャッシュへ記録する。
+							fi, serr := os.Stat(fp)
+							if serr != nil {
+								logError(fmt.Errorf("failed to stat '%s' : %w", fp, serr))
+							} else if perr := cacheIdx.Put(s.object.bucket, *s.object.raw.Key, s.object.CacheVersion(), fi.Size()); perr != nil {
+								logError(perr)
+							}
+						}
+						s.ready <- err
 					}
-				} else if err != nil {
-					logFatal(fmt.Errorf("failed to stat : %w", err))
-				} else if !fi.IsDir() {
-					logFatal(fmt.Errorf("'%s' is not a directory", dir))
-				}
 
-				// ファイルを作る
-				f, err := os.Create(fp)
-				if err != nil {
-					return fmt.Errorf("failed to create local file '%s' : %w", fp, err)
-				}
-				defer func() {
-					if err := f.Close(); err != nil {
-						logFatal(fmt.Errorf("failed to close file : %w", err))
+					if opts.Verbose {
+						stderr("%s ... Done\n", fp)
+					}
+					if err != nil {
+						return err
 					}
-				}()
-
-				// ダウンロード
-				if _, err =
-					s3m.DownloadWithContext(
-						ctx,
-						f,
-						&s3.GetObjectInput{
-							Bucket: &object.bucket,
-							Key:    object.raw.Key,
-						}); err != nil {
-					return fmt.Errorf("failed to download file '%s' : %w", fp, err)
 				}
 				return nil
 			}
-		}(childCtx, object))
+		}(childCtx))
 	}
+
+	// 出力（全ダウンロードの完了を待たず、順序通りに揃い次第出力する）
+	for _, s := range slots {
+		// --no-cache時、ダウンロードエラーはReaderの読み取り時に伝播する
+		if err := <-s.ready; err != nil {
+			logFatal(err)
+		}
+		printObject(ctx, s3c, s)
+	}
+
 	if err := deg.Wait(); err != nil {
 		logFatal(err)
 	}
 
-	// 出力
-	for _, object := range objects {
-		func () {
-			fp := object.LocalPath(opts.Temp)
-
-			var reader io.Reader
-
-			if f, err := os.Open(fp); err != nil {
-				logFatal(fmt.Errorf("failed to open '%s' : %w", fp, err))
-			} else {
-				defer f.Close()
-				reader = f
-			}
-
-			if strings.HasSuffix(fp, ".gz") {
-				if reader, err = gzip.NewReader(reader); err != nil {
-					logFatal(fmt.Errorf("failed to open '%s' as gzip : %w", err))
-				}
-			}
-
-			scanner := bufio.NewScanner(reader)
-			for scanner.Scan() {
-				stdout("%s\n", scanner.Text())
-			}
-		}()
+	// キャッシュが上限サイズを超えていれば、最終アクセスが古いものから削除する
+	if cacheIdx != nil {
+		if err := cacheIdx.Prune(maxCacheSize); err != nil {
+			logFatal(err)
+		}
 	}
 }
 
-func parseArgs(args []string) ([]*s3.ListObjectsV2Input, error) {
-	inputs := make([]*s3.ListObjectsV2Input, 0)
+func parseArgs(args []string) ([]*pattern, error) {
+	patterns := make([]*pattern, 0, len(args))
 	for _, arg := range args {
-		bucket, prefix, err := parseArg(arg)
+		arg, byteRange, err := splitByteRange(arg)
+		if err != nil {
+			return nil, err
+		}
+		bucket, raw, err := splitBucketAndPath(arg)
 		if err != nil {
 			return nil, err
 		}
-		inputs = append(inputs, &s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix})
+		p, err := buildPattern(bucket, raw, byteRange)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
 	}
-	return inputs, nil
+	return patterns, nil
 }
 
-func parseArg(arg string) (bucket, prefix string, err error) {
+// splitBucketAndPath は`/bucket/path...`形式のargをbucketとそれ以降のpathに分割する。
+func splitBucketAndPath(arg string) (bucket, rest string, err error) {
 	if !path.IsAbs(arg) {
 		err = errors.New("PATTERN must be a start with '/'")
 		return
@@ -286,26 +414,185 @@ type objectWrapper struct {
 	bucket string
 	raw    *s3.Object
 	local  bool
+
+	// byteRangeはPATTERNに`#bytes=`が指定された場合の"start-end"・"start-"・
+	// "-suffix"のいずれか。空文字列の場合はObject全体をダウンロードする。
+	byteRange string
+
+	// HeadObjectで取得したContent-Encodingのキャッシュ。--decompress=autoで
+	// Keyの拡張子から展開方式を判別できなかった場合にのみ使用する。
+	contentEncodingFetched bool
+	contentEncoding        string
 }
 
-func (w *objectWrapper) LocalPath(tmp string) string {
-	return path.Join(tmp, w.bucket, *w.raw.Key)
+// CachePath はキャッシュディレクトリdir配下における、このObjectのキャッシュ
+// ファイルパスを返す。ETag（および指定があればbyteRange）をパスに含めることで、
+// Objectの内容が変わっても古いキャッシュを誤って使うことがないようにする
+// （content-addressable）。
+func (w *objectWrapper) CachePath(dir string) string {
+	return path.Join(dir, w.bucket, *w.raw.Key, w.CacheVersion())
 }
 
-func listS3Objects(ctx context.Context, sess *session.Session, inputs []*s3.ListObjectsV2Input) ([]*objectWrapper, error) {
+// CacheVersion はETagとbyteRangeを組み合わせた、このObjectの内容を一意に表す文字列。
+func (w *objectWrapper) CacheVersion() string {
+	v := w.ETag()
+	if w.byteRange != "" {
+		v += "_bytes=" + w.byteRange
+	}
+	return v
+}
+
+// ETag はS3が返すETagから前後の二重引用符を取り除いたものを返す。
+func (w *objectWrapper) ETag() string {
+	if w.raw.ETag == nil {
+		return ""
+	}
+	return cleanETag(*w.raw.ETag)
+}
+
+// GetObjectInput はこのObjectを取得するためのs3.GetObjectInputを組み立てる。
+// byteRangeが指定されている場合はRangeヘッダーを付与する。
+func (w *objectWrapper) GetObjectInput() *s3.GetObjectInput {
+	input := &s3.GetObjectInput{
+		Bucket: &w.bucket,
+		Key:    w.raw.Key,
+	}
+	if w.byteRange != "" {
+		input.Range = aws.String("bytes=" + w.byteRange)
+	}
+	return input
+}
+
+// slotはObject1件分のダウンロード結果を、取得順を保ったまま出力処理へ
+// 受け渡すための器。readyはダウンロード（--no-cache時はReaderの確保）が
+// 完了した時点で一度だけ値が送られる。
+type slot struct {
+	object *objectWrapper
+	reader io.ReadCloser // --no-cache時のみ使用。通常はローカルファイルから読む
+	ready  chan error
+}
+
+// sequentialWriterAtはio.WriterをWriteAtに対応させるためのアダプタ。
+// s3manager.DownloaderのConcurrencyを1にした場合、WriteAtはオフセット順に
+// 隙間なく呼び出されるため、単純にio.Writerへ転送するだけで成立する。
+type sequentialWriterAt struct {
+	w   io.Writer
+	off int64
+}
+
+func (s *sequentialWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off != s.off {
+		return 0, fmt.Errorf("unexpected write offset %d (expected %d)", off, s.off)
+	}
+	n, err := s.w.Write(p)
+	s.off += int64(n)
+	return n, err
+}
+
+// downloadToFileはObjectをopts.Temp配下のローカルファイルへダウンロードする。
+func downloadToFile(ctx context.Context, downloader *s3manager.Downloader, fp string, object *objectWrapper) error {
+	// ディレクトリがなければ作る
+	dir := path.Dir(fp)
+	if fi, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory : %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to stat : %w", err)
+	} else if !fi.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	// ファイルを作る
+	f, err := os.Create(fp)
+	if err != nil {
+		return fmt.Errorf("failed to create local file '%s' : %w", fp, err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			logFatal(fmt.Errorf("failed to close file : %w", err))
+		}
+	}()
+
+	// ダウンロード
+	if _, err := downloader.DownloadWithContext(ctx, f, object.GetObjectInput()); err != nil {
+		return fmt.Errorf("failed to download file '%s' : %w", fp, err)
+	}
+	return nil
+}
+
+// downloadStreamingはObjectをローカルに保存せず、io.Pipe経由でslot.readerへ
+// 直接流し込む。Readerを確保した時点でslot.readyへ通知するため、呼び出し元は
+// ダウンロードの完了を待たずに出力を開始できる。ダウンロードが失敗した場合は
+// pw.CloseWithErrorにより、その場でReaderの読み取り側へエラーが伝播する。
+func downloadStreaming(ctx context.Context, downloader *s3manager.Downloader, s *slot) error {
+	pr, pw := io.Pipe()
+	s.reader = pr
+	s.ready <- nil
+
+	if _, err := downloader.DownloadWithContext(ctx, &sequentialWriterAt{w: pw}, s.object.GetObjectInput()); err != nil {
+		_ = pw.CloseWithError(err)
+		return fmt.Errorf("failed to download object '/%s/%s' : %w", s.object.bucket, *s.object.raw.Key, err)
+	}
+	return pw.Close()
+}
+
+// printObjectはslotの内容（ローカルファイル、または--no-cache時はストリーム）を
+// opts.Decompressに従って展開しながら標準出力へ書き出す。
+func printObject(ctx context.Context, s3c *s3.S3, s *slot) {
+	var (
+		reader io.Reader
+		closer io.Closer
+	)
+
+	if s.reader != nil {
+		reader = s.reader
+		closer = s.reader
+	} else {
+		fp := s.object.CachePath(cacheDir())
+		f, err := os.Open(fp)
+		if err != nil {
+			logFatal(fmt.Errorf("failed to open '%s' : %w", fp, err))
+		}
+		reader = f
+		closer = f
+	}
+	defer closer.Close()
+
+	reader, err := decompressingReader(ctx, s3c, s.object, reader)
+	if err != nil {
+		logFatal(fmt.Errorf("failed to decompress '/%s/%s' : %w", s.object.bucket, *s.object.raw.Key, err))
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		stdout("%s\n", scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		logFatal(fmt.Errorf("failed to read '/%s/%s' : %w", s.object.bucket, *s.object.raw.Key, err))
+	}
+}
+
+func listS3Objects(ctx context.Context, s3c *s3.S3, patterns []*pattern) ([]*objectWrapper, error) {
 	if opts.Verbose {
 		stderr("Fetch S3 object list ")
 	}
+	start := time.Now()
+	var count int
 	defer func() {
 		if opts.Verbose {
-			stderr(" OK\n")
+			elapsed := time.Since(start).Seconds()
+			var rate float64
+			if elapsed > 0 {
+				rate = float64(count) / elapsed
+			}
+			stderr(" OK (%d objects, %.1f objects/sec)\n", count, rate)
 		}
 	}()
-	s3c := s3.New(sess)
 
 	results := make([]*objectWrapper, 0)
-	for _, input := range inputs {
-		objects, err := listS3Object(ctx, s3c, input, nil)
+	for _, p := range patterns {
+		objects, err := listS3Object(ctx, s3c, p, &count)
 		if err != nil {
 			return nil, err
 		}
@@ -315,28 +602,53 @@ func listS3Objects(ctx context.Context, sess *session.Session, inputs []*s3.List
 	return results, nil
 }
 
-func listS3Object(ctx context.Context, s3c *s3.S3, input *s3.ListObjectsV2Input, token *string) ([]*objectWrapper, error) {
-	if opts.Verbose {
-		stderr(".")
+// listS3Object はpのbucket・prefixに対してListObjectsV2PagesWithContextで
+// ページングしながらObjectを列挙する。再帰ではなくページャーのコールバックで
+// 処理するため、Object数が多いbucketでもスタックが深くなることはない。
+// countは呼び出し元と共有する合計件数カウンタで、--verbose時の進捗表示に使う。
+func listS3Object(ctx context.Context, s3c *s3.S3, p *pattern, count *int) ([]*objectWrapper, error) {
+	input := &s3.ListObjectsV2Input{Bucket: &p.bucket, Prefix: &p.prefix}
+	if opts.StartAfter != "" {
+		input.StartAfter = &opts.StartAfter
 	}
-	input.ContinuationToken = token
-	out, err := s3c.ListObjectsV2WithContext(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list S3 objects : %w", err)
-	}
-
-	results := make([]*objectWrapper, len(out.Contents))
-	for i, object := range out.Contents {
-		results[i] = &objectWrapper{bucket: *input.Bucket, raw: object}
+	if opts.MaxKeys > 0 {
+		input.MaxKeys = &opts.MaxKeys
 	}
 
-	if out.NextContinuationToken != nil {
-		nextOut, err := listS3Object(ctx, s3c, input, out.NextContinuationToken)
-		if err != nil {
-			return nil, err
+	results := make([]*objectWrapper, 0)
+	err := s3c.ListObjectsV2PagesWithContext(ctx, input, func(out *s3.ListObjectsV2Output, lastPage bool) bool {
+		if opts.Verbose {
+			stderr(".")
 		}
-		results = append(results, nextOut...)
+		for _, object := range out.Contents {
+			// prefixによる絞り込み後、グロブ・正規表現PATTERNの場合はさらにKeyを照合する
+			if p.matcher != nil && !p.matcher(*object.Key) {
+				continue
+			}
+			if !withinModifiedRange(object.LastModified) {
+				continue
+			}
+			*count++
+			results = append(results, &objectWrapper{bucket: p.bucket, raw: object, byteRange: p.byteRange})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list S3 objects : %w", err)
 	}
 
 	return results, nil
 }
+
+// withinModifiedRange はlastModifiedが--modified-since・--modified-beforeで
+// 指定された範囲内かどうかを判定する。S3はLastModifiedでのサーバー側絞り込みに
+// 対応していないため、ページごとにクライアント側で絞り込む。
+func withinModifiedRange(lastModified *time.Time) bool {
+	if modifiedSince != nil && lastModified.Before(*modifiedSince) {
+		return false
+	}
+	if modifiedBefore != nil && !lastModified.Before(*modifiedBefore) {
+		return false
+	}
+	return true
+}
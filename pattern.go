@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// keyMatcher はS3のKeyがPATTERNに一致するかどうかを判定する。
+type keyMatcher func(key string) bool
+
+// pattern はPATTERNを解析した結果。prefixはListObjectsV2へそのまま渡す値、
+// matcherはprefixで絞り込んだ後、Keyをさらにクライアント側で絞り込むための
+// 関数で、ワイルドカードや正規表現を含まない単純なPATTERNの場合はnilになる
+// （prefix一致のみで絞り込みが完結するため）。byteRangeは`#bytes=`形式の指定が
+// あった場合に"start-end"・"start-"・"-suffix"のいずれかの形でセットされ、
+// 空文字列ならばObject全体をダウンロードする。
+type pattern struct {
+	bucket    string
+	prefix    string
+	matcher   keyMatcher
+	byteRange string
+}
+
+const byteRangeSuffix = "#bytes="
+
+// byteRangePatternは`start-end`・`start-`（startより後ろ全て）・`-suffix`
+// （末尾suffixバイト、HTTPのRangeヘッダーにおけるサフィックス範囲）のいずれかに一致する。
+var byteRangePattern = regexp.MustCompile(`^([0-9]+-[0-9]+|[0-9]+-|-[0-9]+)$`)
+
+// splitByteRange はargの末尾にある`#bytes=start-end`を取り除き、残りの文字列と
+// "start-end"部分を返す。該当する指定がなければbyteRangeは空文字列を返す。
+// "start-end"はGetObjectInputのRangeヘッダーへそのまま渡されるため、`start-`
+// （先頭からstart以降）・`-suffix`（末尾suffixバイト）形式もそのまま通す。
+func splitByteRange(arg string) (rest, byteRange string, err error) {
+	idx := strings.LastIndex(arg, byteRangeSuffix)
+	if idx < 0 {
+		return arg, "", nil
+	}
+
+	spec := arg[idx+len(byteRangeSuffix):]
+	if !byteRangePattern.MatchString(spec) {
+		return "", "", fmt.Errorf("invalid byte range '%s', expected '#bytes=start-end', 'start-', or '-suffix'", spec)
+	}
+	return arg[:idx], spec, nil
+}
+
+const regexPatternPrefix = "re:"
+
+// globSpecialChars はshellスタイルのワイルドカードとして扱う文字。
+const globSpecialChars = "*?["
+
+// buildPattern はbucketと、`/bucket/`より後ろの文字列rawから*patternを組み立てる。
+// rawが`re:`で始まる場合は正規表現として、`*`・`?`・`[...]`・`**`を含む場合は
+// シェルスタイルのグロブとして扱い、それ以外は従来通りprefix一致として扱う。
+// byteRangeは`#bytes=start-end`指定があった場合の"start-end"で、一致した
+// 全Objectへそのまま適用される。
+func buildPattern(bucket, raw, byteRange string) (*pattern, error) {
+	if strings.HasPrefix(raw, regexPatternPrefix) {
+		expr := strings.TrimPrefix(raw, regexPatternPrefix)
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{
+			bucket:    bucket,
+			prefix:    literalPrefixOfRegexp(expr),
+			matcher:   re.MatchString,
+			byteRange: byteRange,
+		}, nil
+	}
+
+	if strings.ContainsAny(raw, globSpecialChars) {
+		re, err := globToRegexp(raw)
+		if err != nil {
+			return nil, err
+		}
+		return &pattern{
+			bucket:    bucket,
+			prefix:    literalPrefixOfGlob(raw),
+			matcher:   re.MatchString,
+			byteRange: byteRange,
+		}, nil
+	}
+
+	return &pattern{bucket: bucket, prefix: raw, byteRange: byteRange}, nil
+}
+
+// literalPrefixOfGlob はrawのうち、最初にワイルドカードが現れるまでの、
+// ワイルドカードを含まない先頭部分を返す。これをListObjectsV2のPrefix
+// として使うことで、サーバー側である程度まで絞り込んだ一覧を取得できる。
+func literalPrefixOfGlob(raw string) string {
+	idx := strings.IndexAny(raw, globSpecialChars)
+	if idx < 0 {
+		return raw
+	}
+	return raw[:idx]
+}
+
+// globToRegexp はシェルスタイルのグロブ（`*`・`?`・`[...]`）をregexpへ変換する。
+// `**`は`/`をまたいだ複数セグメントに一致し、単独の`*`は`/`をまたがない。
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteByte('^')
+
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := i + 1
+			for j < len(runes) && runes[j] != ']' {
+				j++
+			}
+			if j >= len(runes) {
+				sb.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			sb.WriteString(string(runes[i : j+1]))
+			i = j
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteByte('$')
+	return regexp.Compile(sb.String())
+}
+
+// regexSpecialChars はregexpのメタ文字として扱う文字（literalPrefixOfRegexpで使用）。
+const regexSpecialChars = `.*+?()|[]{}^$\`
+
+// literalPrefixOfRegexp はexprの先頭（`^`アンカーは無視する）から、regexpの
+// メタ文字が現れるまでのリテラル部分を返す。globと同様、ListObjectsV2の
+// Prefixとして使うための簡易的な最適化で、厳密な最長一致は保証しない。
+func literalPrefixOfRegexp(expr string) string {
+	expr = strings.TrimPrefix(expr, "^")
+	var sb strings.Builder
+	for _, r := range expr {
+		if strings.ContainsRune(regexSpecialChars, r) {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
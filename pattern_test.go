@@ -0,0 +1,97 @@
+package main
+
+import "testing"
+
+func TestLiteralPrefixOfGlob(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"logs/2024/app.log", "logs/2024/app.log"},
+		{"logs/*.log", "logs/"},
+		{"logs/2024-??/app.log", "logs/2024-"},
+		{"logs/[0-9]*/app.log", "logs/"},
+		{"logs/**/app.log", "logs/"},
+		{"*.log", ""},
+	}
+	for _, tt := range tests {
+		if got := literalPrefixOfGlob(tt.raw); got != tt.want {
+			t.Errorf("literalPrefixOfGlob(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestGlobToRegexpMatch(t *testing.T) {
+	tests := []struct {
+		glob  string
+		key   string
+		match bool
+	}{
+		{"logs/*.log", "logs/app.log", true},
+		{"logs/*.log", "logs/2024/app.log", false}, // 単一`*`は`/`をまたがない
+		{"logs/**/app.log", "logs/2024/01/app.log", true},
+		{"logs/**/app.log", "logs/app.log", false},
+		{"logs/2024-??/app.log", "logs/2024-01/app.log", true},
+		{"logs/2024-??/app.log", "logs/2024-001/app.log", false},
+		{"logs/[0-9]*.log", "logs/1.log", true},
+		{"logs/[0-9]*.log", "logs/a.log", false},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Fatalf("globToRegexp(%q) returned error: %v", tt.glob, err)
+		}
+		if got := re.MatchString(tt.key); got != tt.match {
+			t.Errorf("globToRegexp(%q).MatchString(%q) = %v, want %v", tt.glob, tt.key, got, tt.match)
+		}
+	}
+}
+
+func TestSplitByteRange(t *testing.T) {
+	tests := []struct {
+		arg       string
+		wantRest  string
+		wantRange string
+		wantErr   bool
+	}{
+		{"/bucket/key", "/bucket/key", "", false},
+		{"/bucket/key#bytes=0-99", "/bucket/key", "0-99", false},
+		{"/bucket/key#bytes=100-", "/bucket/key", "100-", false},
+		{"/bucket/key#bytes=-1000", "/bucket/key", "-1000", false},
+		{"/bucket/key#bytes=", "", "", true},
+		{"/bucket/key#bytes=abc", "", "", true},
+		{"/bucket/key#bytes=-", "", "", true},
+	}
+	for _, tt := range tests {
+		rest, byteRange, err := splitByteRange(tt.arg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("splitByteRange(%q) error = nil, want error", tt.arg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("splitByteRange(%q) returned error: %v", tt.arg, err)
+		}
+		if rest != tt.wantRest || byteRange != tt.wantRange {
+			t.Errorf("splitByteRange(%q) = (%q, %q), want (%q, %q)", tt.arg, rest, byteRange, tt.wantRest, tt.wantRange)
+		}
+	}
+}
+
+func TestLiteralPrefixOfRegexp(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"^logs/2024/.*\\.log$", "logs/2024/"},
+		{"logs/app\\.log", "logs/app"},
+		{"logs/[0-9]+/app.log", "logs/"},
+		{".*", ""},
+	}
+	for _, tt := range tests {
+		if got := literalPrefixOfRegexp(tt.expr); got != tt.want {
+			t.Errorf("literalPrefixOfRegexp(%q) = %q, want %q", tt.expr, got, tt.want)
+		}
+	}
+}